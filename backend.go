@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	foundation "github.com/estafette/estafette-foundation"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// backendDocker shells out to the docker cli, the extension's original behaviour.
+	backendDocker = "docker"
+	// backendContainerd shells out to the containerd cli (ctr).
+	backendContainerd = "containerd"
+	// backendRegistry talks to the registry directly using an in-process OCI distribution client, bypassing the
+	// docker daemon entirely.
+	backendRegistry = "registry"
+)
+
+// pullImage fetches a single container image using the configured backend. The docker and containerd backends
+// capture combined stdout/stderr so isTransientError can inspect the registry's actual error output, instead of
+// just the bare "exit status 1" RunCommandWithArgsExtended would otherwise return.
+func pullImage(ctx context.Context, backend, image, contentStorePath string, credentials []ContainerRegistryCredentials) error {
+
+	switch backend {
+	case backendRegistry:
+		return pullImageFromRegistry(ctx, image, contentStorePath, credentials)
+	case backendContainerd:
+		return foundation.RunCommandWithArgsExtendedCombinedStdErr(ctx, "ctr", []string{"image", "pull", image})
+	default:
+		return foundation.RunCommandWithArgsExtendedCombinedStdErr(ctx, "docker", []string{"pull", image})
+	}
+}
+
+// pullImageFromRegistry resolves the image's manifest (honoring any image index so the platform-appropriate variant
+// is picked) and downloads its layers straight from the registry into contentStorePath, verifying digests along the
+// way. This requires no docker daemon, which makes it usable on runners where the daemon socket isn't mounted.
+func pullImageFromRegistry(ctx context.Context, image, contentStorePath string, credentials []ContainerRegistryCredentials) error {
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return fmt.Errorf("failed parsing image reference %v: %w", image, err)
+	}
+
+	img, err := remote.Image(ref,
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(credentialsKeychain{credentials: credentials}),
+		remote.WithPlatform(v1.Platform{OS: "linux", Architecture: runtime.GOARCH}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed fetching manifest for image %v: %w", image, err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("failed resolving digest for image %v: %w", image, err)
+	}
+
+	log.Info().Msgf("Resolved %v to digest %v, downloading layers into %v\n", image, digest, contentStorePath)
+
+	layers, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("failed listing layers for image %v: %w", image, err)
+	}
+
+	for _, layer := range layers {
+		if err := downloadLayerToContentStore(layer, contentStorePath); err != nil {
+			return fmt.Errorf("failed downloading layer for image %v: %w", image, err)
+		}
+	}
+
+	return nil
+}
+
+// downloadLayerToContentStore writes a single layer's compressed blob into contentStorePath, addressed by its
+// digest, skipping the download if the blob is already present.
+func downloadLayerToContentStore(layer v1.Layer, contentStorePath string) error {
+
+	digest, err := layer.Digest()
+	if err != nil {
+		return fmt.Errorf("failed resolving layer digest: %w", err)
+	}
+
+	blobPath := filepath.Join(contentStorePath, digest.Algorithm, digest.Hex)
+	if _, err := os.Stat(blobPath); err == nil {
+		// layer already present in the content store
+		cacheHitsTotal.Inc()
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		return fmt.Errorf("failed creating content store directory for layer %v: %w", digest, err)
+	}
+
+	rc, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("failed reading layer %v: %w", digest, err)
+	}
+	defer rc.Close()
+
+	out, err := os.Create(blobPath)
+	if err != nil {
+		return fmt.Errorf("failed creating blob file for layer %v: %w", digest, err)
+	}
+	defer out.Close()
+
+	written, err := io.Copy(out, rc)
+	if err != nil {
+		return fmt.Errorf("failed writing layer %v to content store: %w", digest, err)
+	}
+	bytesDownloadedTotal.Add(float64(written))
+
+	return nil
+}
+
+// credentialsKeychain adapts our ContainerRegistryCredentials onto go-containerregistry's authn.Keychain interface,
+// so the registry backend authenticates using the same credential helpers, auth.json files and soft-fail behaviour
+// as the docker backend's loginIfRequired.
+type credentialsKeychain struct {
+	credentials []ContainerRegistryCredentials
+}
+
+func (k credentialsKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+
+	// target.String() resolves to the full registry/path repository reference (e.g. "gcr.io/myproject/myimage");
+	// our credentials are keyed by the repository minus the image name (e.g. "gcr.io/myproject"), the same way
+	// getCredentialsForContainers and loginIfRequired derive it from a stage's ContainerImage.
+	repositorySlice := strings.Split(target.String(), "/")
+	repository := strings.Join(repositorySlice[:len(repositorySlice)-1], "/")
+
+	for _, c := range k.credentials {
+		if c.AdditionalProperties.Repository != repository {
+			continue
+		}
+
+		username, password, err := resolveCredentials(c)
+		if err != nil {
+			if c.AdditionalProperties.AuthSoftFail {
+				return authn.Anonymous, nil
+			}
+			return nil, err
+		}
+
+		return authn.FromConfig(authn.AuthConfig{Username: username, Password: password}), nil
+	}
+
+	return authn.Anonymous, nil
+}
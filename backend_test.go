@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialsKeychainResolve(t *testing.T) {
+	t.Run("ReturnsConfigForMatchingRepository", func(t *testing.T) {
+		ref, err := name.ParseReference("gcr.io/myproject/myimage")
+		assert.NoError(t, err)
+
+		keychain := credentialsKeychain{credentials: []ContainerRegistryCredentials{
+			{AdditionalProperties: ContainerRegistryCredentialsAdditionalProperties{Repository: "gcr.io/myproject", Username: "user", Password: "pass"}},
+		}}
+
+		authenticator, err := keychain.Resolve(ref.Context())
+
+		assert.NoError(t, err)
+		authConfig, err := authenticator.Authorization()
+		assert.NoError(t, err)
+		assert.Equal(t, "user", authConfig.Username)
+		assert.Equal(t, "pass", authConfig.Password)
+	})
+
+	t.Run("ReturnsAnonymousWhenNoCredentialMatches", func(t *testing.T) {
+		ref, err := name.ParseReference("gcr.io/myproject/myimage")
+		assert.NoError(t, err)
+
+		keychain := credentialsKeychain{credentials: []ContainerRegistryCredentials{
+			{AdditionalProperties: ContainerRegistryCredentialsAdditionalProperties{Repository: "gcr.io/otherproject", Username: "user", Password: "pass"}},
+		}}
+
+		authenticator, err := keychain.Resolve(ref.Context())
+
+		assert.NoError(t, err)
+		assert.Equal(t, authn.Anonymous, authenticator)
+	})
+
+	t.Run("ReturnsAnonymousWhenResolveFailsAndSoftFailIsSet", func(t *testing.T) {
+		ref, err := name.ParseReference("gcr.io/myproject/myimage")
+		assert.NoError(t, err)
+
+		keychain := credentialsKeychain{credentials: []ContainerRegistryCredentials{
+			{AdditionalProperties: ContainerRegistryCredentialsAdditionalProperties{Repository: "gcr.io/myproject", AuthSoftFail: true}},
+		}}
+
+		authenticator, err := keychain.Resolve(ref.Context())
+
+		assert.NoError(t, err)
+		assert.Equal(t, authn.Anonymous, authenticator)
+	})
+
+	t.Run("ReturnsErrorWhenResolveFailsWithoutSoftFail", func(t *testing.T) {
+		ref, err := name.ParseReference("gcr.io/myproject/myimage")
+		assert.NoError(t, err)
+
+		keychain := credentialsKeychain{credentials: []ContainerRegistryCredentials{
+			{AdditionalProperties: ContainerRegistryCredentialsAdditionalProperties{Repository: "gcr.io/myproject"}},
+		}}
+
+		_, err = keychain.Resolve(ref.Context())
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// ContainerRegistryCredentials is the credentials for logging in to a container registry, configured at the CI
+// server and injected into this trusted extension via ESTAFETTE_CREDENTIALS_CONTAINER_REGISTRY.
+type ContainerRegistryCredentials struct {
+	Name                 string                                            `json:"name,omitempty"`
+	Type                 string                                            `json:"type,omitempty"`
+	AdditionalProperties ContainerRegistryCredentialsAdditionalProperties `json:"additionalProperties,omitempty"`
+}
+
+// ContainerRegistryCredentialsAdditionalProperties contains the credential type specific, non-generic properties.
+// A credential can either carry a plain username/password, point to an external docker credential helper binary
+// (e.g. "ecr-login"), or point at an auth.json/config.json file to read the repository's auth entry from.
+type ContainerRegistryCredentialsAdditionalProperties struct {
+	Repository string `json:"repository,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+
+	// Helper is the name of a docker credential helper binary (invoked as docker-credential-<helper> get), as used
+	// by nomad-driver-podman's registry package.
+	Helper string `json:"helper,omitempty"`
+
+	// AuthConfigPath points to an external auth.json/config.json file whose "auths" map is consulted for this
+	// repository's base64 encoded credentials.
+	AuthConfigPath string `json:"authConfigPath,omitempty"`
+
+	// AuthSoftFail prevents an error when no credentials can be resolved for this repository, so prefetching
+	// public images doesn't fail the build.
+	AuthSoftFail bool `json:"authSoftFail,omitempty"`
+}
+
+// dockerCredentialHelperOutput is the json response of a `docker-credential-<helper> get` invocation
+type dockerCredentialHelperOutput struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// dockerAuthConfigFile mirrors the relevant parts of a docker config.json / auth.json file
+type dockerAuthConfigFile struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+}
+
+// resolveCredentials resolves the username and password for a credential entry, supporting an external docker
+// credential helper, an auth.json/config.json file, or a plain username/password, in that order of precedence.
+func resolveCredentials(c ContainerRegistryCredentials) (username, password string, err error) {
+
+	switch {
+	case c.AdditionalProperties.Helper != "":
+		return getCredentialsFromHelper(c.AdditionalProperties.Helper, c.AdditionalProperties.Repository)
+	case c.AdditionalProperties.AuthConfigPath != "":
+		return getCredentialsFromAuthConfigFile(c.AdditionalProperties.AuthConfigPath, c.AdditionalProperties.Repository)
+	case c.AdditionalProperties.Username != "":
+		return c.AdditionalProperties.Username, c.AdditionalProperties.Password, nil
+	}
+
+	return "", "", fmt.Errorf("no credentials configured for repository %v", c.AdditionalProperties.Repository)
+}
+
+// getCredentialsFromHelper invokes the docker-credential-<helper> binary to retrieve the username/secret for a
+// repository, passing the repository url over stdin and parsing the {"Username","Secret"} json response from
+// stdout, as documented by the docker-credential-helpers protocol.
+func getCredentialsFromHelper(helper, repository string) (username, password string, err error) {
+
+	cmd := exec.Command(fmt.Sprintf("docker-credential-%v", helper), "get")
+	cmd.Stdin = strings.NewReader(repository)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+
+	err = cmd.Run()
+	if err != nil {
+		return "", "", fmt.Errorf("failed invoking docker-credential-%v: %w", helper, err)
+	}
+
+	var output dockerCredentialHelperOutput
+	err = json.Unmarshal(out.Bytes(), &output)
+	if err != nil {
+		return "", "", fmt.Errorf("failed unmarshalling output of docker-credential-%v: %w", helper, err)
+	}
+
+	return output.Username, output.Secret, nil
+}
+
+// getCredentialsFromAuthConfigFile reads a docker auth.json/config.json file and decodes the base64 "auth" entry
+// for the given repository.
+func getCredentialsFromAuthConfigFile(path, repository string) (username, password string, err error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed reading auth config file %v: %w", path, err)
+	}
+
+	var config dockerAuthConfigFile
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return "", "", fmt.Errorf("failed unmarshalling auth config file %v: %w", path, err)
+	}
+
+	entry, ok := config.Auths[repository]
+	if !ok {
+		return "", "", fmt.Errorf("no auth entry found for repository %v in %v", repository, path)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+	if err != nil {
+		return "", "", fmt.Errorf("failed base64 decoding auth entry for repository %v in %v: %w", repository, path, err)
+	}
+
+	usernameAndPassword := strings.SplitN(string(decoded), ":", 2)
+	if len(usernameAndPassword) != 2 {
+		return "", "", fmt.Errorf("auth entry for repository %v in %v is not in username:password format", repository, path)
+	}
+
+	return usernameAndPassword[0], usernameAndPassword[1], nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveCredentials(t *testing.T) {
+	t.Run("ReturnsPlainUsernameAndPassword", func(t *testing.T) {
+		credential := ContainerRegistryCredentials{
+			AdditionalProperties: ContainerRegistryCredentialsAdditionalProperties{
+				Repository: "gcr.io/myproject",
+				Username:   "user",
+				Password:   "pass",
+			},
+		}
+
+		username, password, err := resolveCredentials(credential)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "pass", password)
+	})
+
+	t.Run("ReturnsErrorWhenNothingConfigured", func(t *testing.T) {
+		credential := ContainerRegistryCredentials{
+			AdditionalProperties: ContainerRegistryCredentialsAdditionalProperties{
+				Repository: "gcr.io/myproject",
+			},
+		}
+
+		_, _, err := resolveCredentials(credential)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestGetCredentialsFromAuthConfigFile(t *testing.T) {
+	t.Run("DecodesBase64AuthEntryForRepository", func(t *testing.T) {
+		dir := t.TempDir()
+		authConfigPath := filepath.Join(dir, "auth.json")
+
+		// base64("user:pass") == "dXNlcjpwYXNz"
+		content := `{"auths":{"gcr.io/myproject":{"auth":"dXNlcjpwYXNz"}}}`
+		err := ioutil.WriteFile(authConfigPath, []byte(content), 0644)
+		assert.NoError(t, err)
+
+		username, password, err := getCredentialsFromAuthConfigFile(authConfigPath, "gcr.io/myproject")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "pass", password)
+	})
+
+	t.Run("ReturnsErrorWhenRepositoryNotPresent", func(t *testing.T) {
+		dir := t.TempDir()
+		authConfigPath := filepath.Join(dir, "auth.json")
+
+		err := ioutil.WriteFile(authConfigPath, []byte(`{"auths":{}}`), 0644)
+		assert.NoError(t, err)
+
+		_, _, err = getCredentialsFromAuthConfigFile(authConfigPath, "gcr.io/myproject")
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/rs/zerolog/log"
+)
+
+// parseMirrors parses a comma separated list of registry=mirror pairs (e.g.
+// "docker.io=mirror.gcr.io,quay.io=quay-mirror.internal") into a lookup map.
+func parseMirrors(raw string) (map[string]string, error) {
+
+	mirrorMap := map[string]string{}
+
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return mirrorMap, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid mirror entry %v, expected format registry=mirror", pair)
+		}
+
+		mirrorMap[canonicalizeRegistryHost(parts[0])] = parts[1]
+	}
+
+	return mirrorMap, nil
+}
+
+// canonicalizeRegistryHost normalizes a user-provided registry host the same way go-containerregistry's
+// name.ParseReference does internally (e.g. "docker.io" resolves to name.DefaultRegistry), so mirrorMap keys line
+// up with what ref.Context().RegistryStr() actually returns.
+func canonicalizeRegistryHost(host string) string {
+
+	if host == "docker.io" {
+		return name.DefaultRegistry
+	}
+
+	return host
+}
+
+// rewriteToMirror rewrites image's registry host to its configured mirror, if any, by reassembling the reference
+// from its parsed repository and identifier (tag or digest) rather than doing string-prefix surgery on the
+// original, unparsed string, which breaks for any reference that doesn't spell out its registry literally (e.g.
+// "golang:1.16", where the registry is implied to be "index.docker.io"). The second return value is false when
+// image's registry has no mirror configured.
+func rewriteToMirror(image string, mirrorMap map[string]string) (string, bool) {
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", false
+	}
+
+	registry := ref.Context().RegistryStr()
+
+	mirror, ok := mirrorMap[registry]
+	if !ok {
+		return "", false
+	}
+
+	separator := ":"
+	if _, isDigest := ref.(name.Digest); isDigest {
+		separator = "@"
+	}
+
+	return fmt.Sprintf("%v/%v%v%v", mirror, ref.Context().RepositoryStr(), separator, ref.Identifier()), true
+}
+
+// resolveDigests resolves each image to its immutable digest via a HEAD on the manifest endpoint, falling back to
+// a configured mirror on failure, and returns a mapping of the original image reference to repo@sha256:....
+// Images that can't be resolved, even against a mirror, are omitted and logged.
+func resolveDigests(ctx context.Context, images []string, mirrorMap map[string]string, credentials []ContainerRegistryCredentials) map[string]string {
+
+	digestMapping := map[string]string{}
+
+	for _, image := range images {
+		pinned, err := resolveDigest(ctx, image, credentials)
+		if err != nil {
+			if mirrorImage, ok := rewriteToMirror(image, mirrorMap); ok {
+				pinned, err = resolveDigest(ctx, mirrorImage, credentials)
+			}
+		}
+
+		if err != nil {
+			log.Info().Msgf("Failed resolving digest for %v: %v", image, err)
+			continue
+		}
+
+		digestMapping[image] = pinned
+	}
+
+	return digestMapping
+}
+
+// resolveDigest performs a HEAD request against the registry's manifest endpoint to resolve image to its
+// repo@sha256:... form, without downloading the manifest body or any layers.
+func resolveDigest(ctx context.Context, image string, credentials []ContainerRegistryCredentials) (string, error) {
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("failed parsing image reference %v: %w", image, err)
+	}
+
+	descriptor, err := remote.Head(ref, remote.WithContext(ctx), remote.WithAuthFromKeychain(credentialsKeychain{credentials: credentials}))
+	if err != nil {
+		return "", fmt.Errorf("failed resolving manifest digest for %v: %w", image, err)
+	}
+
+	return fmt.Sprintf("%v@%v", ref.Context().Name(), descriptor.Digest), nil
+}
+
+// writeDigestMappingFile writes the resolved image digest mapping to path as json, so later pipeline stages can
+// consume it to pin ContainerImage to an immutable digest.
+func writeDigestMappingFile(path string, digestMapping map[string]string) error {
+
+	data, err := json.MarshalIndent(digestMapping, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed marshalling digest mapping: %w", err)
+	}
+
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed writing digest mapping file %v: %w", path, err)
+	}
+
+	log.Info().Msgf("Wrote digest mapping for %v images to %v\n", len(digestMapping), path)
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMirrors(t *testing.T) {
+	t.Run("ParsesCommaSeparatedPairs", func(t *testing.T) {
+		mirrorMap, err := parseMirrors("docker.io=mirror.gcr.io,quay.io=quay-mirror.internal")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "mirror.gcr.io", mirrorMap[name.DefaultRegistry])
+		assert.Equal(t, "quay-mirror.internal", mirrorMap["quay.io"])
+	})
+
+	t.Run("ReturnsEmptyMapForEmptyInput", func(t *testing.T) {
+		mirrorMap, err := parseMirrors("")
+
+		assert.NoError(t, err)
+		assert.Empty(t, mirrorMap)
+	})
+
+	t.Run("ReturnsErrorForMalformedEntry", func(t *testing.T) {
+		_, err := parseMirrors("docker.io")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestRewriteToMirror(t *testing.T) {
+	t.Run("RewritesRegistryHostToMirror", func(t *testing.T) {
+		mirrorMap := map[string]string{name.DefaultRegistry: "mirror.gcr.io"}
+
+		mirrored, ok := rewriteToMirror("index.docker.io/library/golang:1.16", mirrorMap)
+
+		assert.True(t, ok)
+		assert.Equal(t, "mirror.gcr.io/library/golang:1.16", mirrored)
+	})
+
+	t.Run("RewritesUnqualifiedOfficialImageReference", func(t *testing.T) {
+		mirrorMap := map[string]string{name.DefaultRegistry: "mirror.gcr.io"}
+
+		mirrored, ok := rewriteToMirror("golang:1.16", mirrorMap)
+
+		assert.True(t, ok)
+		assert.Equal(t, "mirror.gcr.io/library/golang:1.16", mirrored)
+	})
+
+	t.Run("RewritesDigestReferences", func(t *testing.T) {
+		mirrorMap := map[string]string{"gcr.io": "gcr-mirror.internal"}
+
+		mirrored, ok := rewriteToMirror("gcr.io/myproject/myimage@sha256:"+fakeDigestHex, mirrorMap)
+
+		assert.True(t, ok)
+		assert.Equal(t, "gcr-mirror.internal/myproject/myimage@sha256:"+fakeDigestHex, mirrored)
+	})
+
+	t.Run("ReturnsFalseWhenNoMirrorConfigured", func(t *testing.T) {
+		_, ok := rewriteToMirror("gcr.io/myproject/myimage", map[string]string{})
+
+		assert.False(t, ok)
+	})
+}
+
+// fakeDigestHex is a syntactically valid sha256 hex digest used purely to build test image references.
+const fakeDigestHex = "0000000000000000000000000000000000000000000000000000000000000000"
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	imagesFromDockerFileRegex *regexp.Regexp
+)
+
+// findDockerfilePaths resolves a list of glob patterns to a deduplicated list of Dockerfile paths.
+func findDockerfilePaths(patterns []string) ([]string, error) {
+
+	paths := []string{}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed resolving dockerfile glob pattern %v: %w", pattern, err)
+		}
+
+		for _, m := range matches {
+			alreadyAdded := false
+			for _, p := range paths {
+				if p == m {
+					alreadyAdded = true
+					break
+				}
+			}
+			if !alreadyAdded {
+				paths = append(paths, m)
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// getFromImagePathsFromDockerfiles reads every Dockerfile at the given paths and returns the deduplicated set of
+// FROM images found across all of them.
+func getFromImagePathsFromDockerfiles(paths []string) ([]string, error) {
+
+	containerImages := []string{}
+
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading dockerfile %v: %w", path, err)
+		}
+
+		images, err := getFromImagePathsFromDockerfile(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed extracting FROM images from dockerfile %v: %w", path, err)
+		}
+
+		for _, image := range images {
+			alreadyAdded := false
+			for _, existing := range containerImages {
+				if existing == image {
+					alreadyAdded = true
+					break
+				}
+			}
+			if !alreadyAdded {
+				containerImages = append(containerImages, image)
+			}
+		}
+	}
+
+	return containerImages, nil
+}
+
+// getFromImagePathsFromDockerfile extracts the images referenced by FROM lines in a Dockerfile, resolving
+// ARG-substituted images (e.g. FROM ${BASE_IMAGE}) against the process environment, skipping the scratch pseudo
+// image, and skipping multi-stage references to an earlier stage by its AS alias (e.g. FROM builder AS final).
+func getFromImagePathsFromDockerfile(dockerfileContent []byte) ([]string, error) {
+
+	containerImages := []string{}
+	stageAliases := map[string]bool{}
+
+	if imagesFromDockerFileRegex == nil {
+		imagesFromDockerFileRegex = regexp.MustCompile(`(?im)^\s*FROM\s+(?:--platform=\S+\s+)?(\S+)(?:\s+AS\s+(\S+))?\s*$`)
+	}
+
+	matches := imagesFromDockerFileRegex.FindAllStringSubmatch(string(dockerfileContent), -1)
+
+	for _, m := range matches {
+		if len(m) < 2 || m[1] == "" {
+			continue
+		}
+
+		image := expandEstafetteEnvVars(m[1])
+		alias := ""
+		if len(m) > 2 {
+			alias = m[2]
+		}
+
+		// skip the scratch pseudo image and references to an earlier build stage by its alias
+		if strings.EqualFold(image, "scratch") || stageAliases[image] {
+			if alias != "" {
+				stageAliases[alias] = true
+			}
+			continue
+		}
+
+		containerImages = append(containerImages, image)
+
+		if alias != "" {
+			stageAliases[alias] = true
+		}
+	}
+
+	return containerImages, nil
+}
+
+// expandEstafetteEnvVars resolves ARG-substituted base images using the process environment, in particular the
+// ESTAFETTE_* variables injected by the CI server, similar to envsubst.
+func expandEstafetteEnvVars(image string) string {
+	return os.Expand(image, os.Getenv)
+}
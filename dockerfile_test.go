@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFromImagePathsFromDockerfile(t *testing.T) {
+	t.Run("ReturnsImageFromSingleStageDockerfile", func(t *testing.T) {
+		dockerfileContent := []byte("FROM estafette/golang-builder:1.16\n")
+
+		images, err := getFromImagePathsFromDockerfile(dockerfileContent)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"estafette/golang-builder:1.16"}, images)
+	})
+
+	t.Run("SkipsScratch", func(t *testing.T) {
+		dockerfileContent := []byte("FROM scratch\n")
+
+		images, err := getFromImagePathsFromDockerfile(dockerfileContent)
+
+		assert.NoError(t, err)
+		assert.Empty(t, images)
+	})
+
+	t.Run("SkipsReferencesToEarlierStageByAlias", func(t *testing.T) {
+		dockerfileContent := []byte("FROM estafette/golang-builder:1.16 AS builder\nFROM builder AS final\n")
+
+		images, err := getFromImagePathsFromDockerfile(dockerfileContent)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"estafette/golang-builder:1.16"}, images)
+	})
+
+	t.Run("HandlesPlatformFlag", func(t *testing.T) {
+		dockerfileContent := []byte("FROM --platform=linux/amd64 estafette/golang-builder:1.16 AS builder\n")
+
+		images, err := getFromImagePathsFromDockerfile(dockerfileContent)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"estafette/golang-builder:1.16"}, images)
+	})
+
+	t.Run("ExpandsEnvVarsInImage", func(t *testing.T) {
+		os.Setenv("ESTAFETTE_TEST_BASE_IMAGE_TAG", "1.16")
+		defer os.Unsetenv("ESTAFETTE_TEST_BASE_IMAGE_TAG")
+
+		dockerfileContent := []byte("FROM estafette/golang-builder:${ESTAFETTE_TEST_BASE_IMAGE_TAG}\n")
+
+		images, err := getFromImagePathsFromDockerfile(dockerfileContent)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"estafette/golang-builder:1.16"}, images)
+	})
+}
+
+func TestFindDockerfilePaths(t *testing.T) {
+	t.Run("DeduplicatesMatchesAcrossPatterns", func(t *testing.T) {
+		dir := t.TempDir()
+		dockerfilePath := filepath.Join(dir, "Dockerfile")
+		err := ioutil.WriteFile(dockerfilePath, []byte("FROM scratch\n"), 0644)
+		assert.NoError(t, err)
+
+		paths, err := findDockerfilePaths([]string{dockerfilePath, dockerfilePath})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{dockerfilePath}, paths)
+	})
+}
@@ -5,10 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
-	"regexp"
+	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/Knetic/govaluate"
@@ -29,10 +29,43 @@ var (
 )
 
 var (
-	credentialsJSON = kingpin.Flag("credentials", "Container registry credentials configured at the CI server, passed in to this trusted extension.").Envar("ESTAFETTE_CREDENTIALS_CONTAINER_REGISTRY").Required().String()
-	stagesJSON      = kingpin.Flag("stages", "Executed stages, to determine what images to prefetch.").Envar("ESTAFETTE_STAGES").Required().String()
+	credentialsJSON  = kingpin.Flag("credentials", "Container registry credentials configured at the CI server, passed in to this trusted extension.").Envar("ESTAFETTE_CREDENTIALS_CONTAINER_REGISTRY").Required().String()
+	stagesJSON       = kingpin.Flag("stages", "Executed stages, to determine what images to prefetch. Required unless --serve is set, since a --serve daemon receives its stages per request via POST /prefetch instead.").Envar("ESTAFETTE_STAGES").String()
+	dockerfiles      = kingpin.Flag("dockerfiles", "Comma separated list of glob patterns for Dockerfiles in the workspace to scan for FROM images to prefetch.").Envar("ESTAFETTE_EXTENSION_DOCKERFILES").Default("").String()
+	backend          = kingpin.Flag("backend", "Backend used to prefetch images: docker and containerd shell out to their respective cli, registry talks to the registry directly without needing a daemon.").Envar("ESTAFETTE_EXTENSION_BACKEND").Default(backendDocker).Enum(backendDocker, backendContainerd, backendRegistry)
+	contentStorePath = kingpin.Flag("content-store-path", "Local directory layers are downloaded into when using the registry backend.").Envar("ESTAFETTE_EXTENSION_CONTENT_STORE_PATH").Default("/var/lib/estafette-prefetch").String()
+
+	maxParallel          = kingpin.Flag("max-parallel", "Maximum number of images to pull concurrently.").Envar("ESTAFETTE_EXTENSION_MAX_PARALLEL").Default(strconv.Itoa(capNumCPU(10))).Int()
+	maxRetries           = kingpin.Flag("max-retries", "Maximum number of retries for a transient pull failure.").Envar("ESTAFETTE_EXTENSION_MAX_RETRIES").Default("3").Int()
+	retryBackoffStrategy = kingpin.Flag("retry-backoff", "Backoff strategy applied between retries.").Envar("ESTAFETTE_EXTENSION_RETRY_BACKOFF").Default(backoffExponential).Enum(backoffExponential, backoffLinear)
+
+	pinDigests        = kingpin.Flag("pin-digests", "Resolve each image to its immutable digest and write a mapping file later stages can use to pin ContainerImage to repo@sha256:....").Envar("ESTAFETTE_EXTENSION_PIN_DIGESTS").Default("false").Bool()
+	digestMappingPath = kingpin.Flag("digest-mapping-path", "Path the resolved image digest mapping is written to when --pin-digests is set.").Envar("ESTAFETTE_EXTENSION_DIGEST_MAPPING_PATH").Default("/estafette-work/.prefetch-digests.json").String()
+	mirrors           = kingpin.Flag("mirrors", "Comma separated list of registry=mirror pairs to fall back to when resolving or pulling an image fails, e.g. docker.io=mirror.gcr.io,quay.io=quay-mirror.internal.").Envar("ESTAFETTE_EXTENSION_MIRRORS").Default("").String()
+
+	serve        = kingpin.Flag("serve", "Run as a long-lived daemon exposing Prometheus metrics and a prefetch http api, instead of the default one-shot behaviour.").Envar("ESTAFETTE_EXTENSION_SERVE").Default("false").Bool()
+	serveAddress = kingpin.Flag("serve-address", "Address the --serve http api listens on.").Envar("ESTAFETTE_EXTENSION_SERVE_ADDRESS").Default(":9001").String()
 )
 
+// capNumCPU returns the number of available cpus, capped at max, to use as a sane default for --max-parallel.
+func capNumCPU(max int) int {
+	n := runtime.NumCPU()
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// validateRequiredFlags checks constraints kingpin can't express declaratively: --stages is required for the
+// default one-shot behaviour, but a --serve daemon receives its stages per request via POST /prefetch instead, so
+// it must be allowed to start without it.
+func validateRequiredFlags(serve bool, stagesJSON string) error {
+	if !serve && stagesJSON == "" {
+		return errors.New("required flag --stages not provided")
+	}
+	return nil
+}
+
 func main() {
 
 	// parse command line parameters
@@ -47,6 +80,15 @@ func main() {
 	// log startup message
 	log.Info().Msgf("Starting estafette-extension-prefetch version %v...", version)
 
+	if err := validateRequiredFlags(*serve, *stagesJSON); err != nil {
+		log.Fatal().Err(err).Msg("Missing required configuration")
+	}
+
+	if *serve {
+		runServer(ctx)
+		return
+	}
+
 	// get api token from injected credentials
 	var credentials []ContainerRegistryCredentials
 	if *credentialsJSON != "" {
@@ -71,55 +113,10 @@ func main() {
 
 	prefetchStart := time.Now()
 
-	// deduplicate stages by image path
-	dedupedStages := []*manifest.EstafetteStage{}
-	for _, p := range stages {
-
-		// test if the when clause passes
-		whenEvaluationResult, err := evaluateWhen(p.Name, p.When, getParameters())
-		if err != nil || !whenEvaluationResult {
-			continue
-		}
-
-		// test if it's already added
-		alreadyAdded := false
-		for _, d := range dedupedStages {
-			if p.ContainerImage == d.ContainerImage {
-				alreadyAdded = true
-				break
-			}
-		}
-
-		// added if it hasn't been added before
-		if !alreadyAdded {
-			dedupedStages = append(dedupedStages, p)
-		}
-	}
-
-	var wg sync.WaitGroup
-	wg.Add(len(dedupedStages))
-
-	// login
-	loginIfRequired(ctx, credentials, dedupedStages...)
-
-	// pull all images in parallel
-	for _, p := range dedupedStages {
-		go func(p manifest.EstafetteStage) {
-			defer wg.Done()
-			log.Info().Msgf("Pulling container image %v\n", p.ContainerImage)
-			pullArgs := []string{
-				"pull",
-				p.ContainerImage,
-			}
-			foundation.RunCommandWithArgsExtended(ctx, "docker", pullArgs)
-		}(*p)
-	}
-
-	// wait for all pulls to finish
-	wg.Wait()
+	imagesPulled := runPrefetch(ctx, credentials, stages)
 	prefetchDuration := time.Since(prefetchStart)
 
-	log.Info().Msgf("Done prefetching %v images in %v seconds", len(dedupedStages), prefetchDuration.Seconds())
+	log.Info().Msgf("Done prefetching %v images in %v seconds", imagesPulled, prefetchDuration.Seconds())
 }
 
 func getCredentialsForContainers(credentials []ContainerRegistryCredentials, containerImages []string) map[string]*ContainerRegistryCredentials {
@@ -151,37 +148,9 @@ func getCredentialsForContainers(credentials []ContainerRegistryCredentials, con
 	return filteredCredentialsMap
 }
 
-var (
-	imagesFromDockerFileRegex *regexp.Regexp
-)
-
-func getFromImagePathsFromDockerfile(dockerfileContent []byte) ([]string, error) {
-
-	containerImages := []string{}
-
-	if imagesFromDockerFileRegex == nil {
-		imagesFromDockerFileRegex = regexp.MustCompile(`(?im)^FROM\s*([^\s]+)(\s*AS\s[a-zA-Z0-9]+)?\s*$`)
-	}
-
-	matches := imagesFromDockerFileRegex.FindAllStringSubmatch(string(dockerfileContent), -1)
-
-	if len(matches) > 0 {
-		for _, m := range matches {
-			if len(m) > 1 {
-				// check if it's not an official docker hub image
-				if strings.Count(m[1], "/") != 0 {
-					containerImages = append(containerImages, m[1])
-				}
-			}
-		}
-	}
-
-	return containerImages, nil
-}
+func loginIfRequired(ctx context.Context, credentials []ContainerRegistryCredentials, additionalImages []string, stages ...*manifest.EstafetteStage) {
 
-func loginIfRequired(ctx context.Context, credentials []ContainerRegistryCredentials, stages ...*manifest.EstafetteStage) {
-
-	containerImages := []string{}
+	containerImages := append([]string{}, additionalImages...)
 	for _, s := range stages {
 		containerImages = append(containerImages, s.ContainerImage)
 	}
@@ -195,25 +164,41 @@ func loginIfRequired(ctx context.Context, credentials []ContainerRegistryCredent
 
 	if filteredCredentialsMap != nil {
 		for _, c := range filteredCredentialsMap {
-			if c != nil {
-				log.Info().Msgf("Logging in to repository '%v'\n", c.AdditionalProperties.Repository)
-				loginArgs := []string{
-					"login",
-					"--username",
-					c.AdditionalProperties.Username,
-					"--password",
-					c.AdditionalProperties.Password,
-				}
+			if c == nil {
+				continue
+			}
 
-				repositorySlice := strings.Split(c.AdditionalProperties.Repository, "/")
-				if len(repositorySlice) > 1 {
-					server := repositorySlice[0]
-					loginArgs = append(loginArgs, server)
+			username, password, err := resolveCredentials(*c)
+			if err != nil {
+				if c.AdditionalProperties.AuthSoftFail {
+					log.Info().Msgf("No credentials resolved for repository '%v', skipping login since auth_soft_fail is set: %v\n", c.AdditionalProperties.Repository, err)
+					continue
 				}
-
-				err := foundation.RunCommandWithArgsExtended(ctx, "docker", loginArgs)
 				foundation.HandleError(err)
+				continue
 			}
+
+			log.Info().Msgf("Logging in to repository '%v'\n", c.AdditionalProperties.Repository)
+
+			// pass the password over stdin instead of as a command line argument, so it doesn't leak into the
+			// process listing or shell history
+			loginArgs := []string{
+				"login",
+				"--username",
+				username,
+				"--password-stdin",
+			}
+
+			repositorySlice := strings.Split(c.AdditionalProperties.Repository, "/")
+			if len(repositorySlice) > 1 {
+				server := repositorySlice[0]
+				loginArgs = append(loginArgs, server)
+			}
+
+			loginCmd := exec.CommandContext(ctx, "docker", loginArgs...)
+			loginCmd.Stdin = strings.NewReader(password)
+			err = loginCmd.Run()
+			foundation.HandleError(err)
 		}
 	}
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRequiredFlags(t *testing.T) {
+	t.Run("ReturnsErrorWhenStagesMissingAndNotServing", func(t *testing.T) {
+		err := validateRequiredFlags(false, "")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("ReturnsNoErrorWhenStagesProvided", func(t *testing.T) {
+		err := validateRequiredFlags(false, `[{"name":"build"}]`)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("ReturnsNoErrorWhenServingWithoutStages", func(t *testing.T) {
+		err := validateRequiredFlags(true, "")
+
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pullsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "estafette_prefetch_pulls_total",
+		Help: "Total number of image pulls, including their retries and mirror fallback, by registry and result.",
+	}, []string{"registry", "result"})
+
+	pullDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "estafette_prefetch_pull_duration_seconds",
+		Help:    "Duration in seconds of an image pull, by registry.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"registry"})
+
+	bytesDownloadedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "estafette_prefetch_bytes_downloaded_total",
+		Help: "Total number of layer bytes downloaded via the registry backend.",
+	})
+
+	cacheHitsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "estafette_prefetch_cache_hits_total",
+		Help: "Total number of layers that were already present in the local content store.",
+	})
+)
+
+// registryFromImage extracts the registry host portion of an image reference for metrics labeling.
+func registryFromImage(image string) string {
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "unknown"
+	}
+
+	return ref.Context().RegistryStr()
+}
+
+// recordPullMetrics records the final outcome and total duration, including retries and mirror fallback, of pulling
+// a single image.
+func recordPullMetrics(image string, duration time.Duration, err error) {
+
+	registry := registryFromImage(image)
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	pullsTotal.WithLabelValues(registry, result).Inc()
+	pullDurationSeconds.WithLabelValues(registry).Observe(duration.Seconds())
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryFromImage(t *testing.T) {
+	t.Run("ReturnsRegistryHostForValidImage", func(t *testing.T) {
+		registry := registryFromImage("gcr.io/myproject/myimage:latest")
+
+		assert.Equal(t, "gcr.io", registry)
+	})
+
+	t.Run("ReturnsUnknownForInvalidImage", func(t *testing.T) {
+		registry := registryFromImage("")
+
+		assert.Equal(t, "unknown", registry)
+	})
+}
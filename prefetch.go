@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	manifest "github.com/estafette/estafette-ci-manifest"
+	"github.com/rs/zerolog/log"
+)
+
+// runPrefetch executes one full prefetch cycle for the given stages: it deduplicates stage images, discovers
+// Dockerfiles in the workspace, optionally pins digests, logs in where required, and pulls every image in
+// parallel using the configured backend. It returns the number of images pulled. It is used both by the default
+// one-shot CLI behaviour and by the --serve http api's POST /prefetch endpoint.
+func runPrefetch(ctx context.Context, credentials []ContainerRegistryCredentials, stages []*manifest.EstafetteStage) int {
+
+	// deduplicate stages by image path
+	dedupedStages := []*manifest.EstafetteStage{}
+	for _, p := range stages {
+
+		// test if the when clause passes
+		whenEvaluationResult, err := evaluateWhen(p.Name, p.When, getParameters())
+		if err != nil || !whenEvaluationResult {
+			continue
+		}
+
+		// test if it's already added
+		alreadyAdded := false
+		for _, d := range dedupedStages {
+			if p.ContainerImage == d.ContainerImage {
+				alreadyAdded = true
+				break
+			}
+		}
+
+		// added if it hasn't been added before
+		if !alreadyAdded {
+			dedupedStages = append(dedupedStages, p)
+		}
+	}
+
+	// discover Dockerfiles in the workspace and extract their FROM images, so image-build pipelines get their base
+	// images warmed too, not just the stage images
+	dockerfileImages := []string{}
+	if *dockerfiles != "" {
+		dockerfilePaths, err := findDockerfilePaths(strings.Split(*dockerfiles, ","))
+		if err != nil {
+			log.Info().Msgf("Failed discovering dockerfiles for patterns %v: %v", *dockerfiles, err)
+		} else {
+			dockerfileImages, err = getFromImagePathsFromDockerfiles(dockerfilePaths)
+			if err != nil {
+				log.Info().Msgf("Failed extracting FROM images from dockerfiles %v: %v", dockerfilePaths, err)
+			}
+		}
+	}
+
+	// build the deduplicated set of image references to prefetch: stage images plus images discovered in Dockerfiles
+	imagesToPull := []string{}
+	for _, p := range dedupedStages {
+		imagesToPull = append(imagesToPull, p.ContainerImage)
+	}
+	for _, image := range dockerfileImages {
+		alreadyAdded := false
+		for _, i := range imagesToPull {
+			if i == image {
+				alreadyAdded = true
+				break
+			}
+		}
+		if !alreadyAdded {
+			imagesToPull = append(imagesToPull, image)
+		}
+	}
+
+	mirrorMap, err := parseMirrors(*mirrors)
+	if err != nil {
+		log.Info().Msgf("Failed parsing --mirrors %v: %v", *mirrors, err)
+	}
+
+	// resolve images to their immutable digest and write a mapping file later stages can use to pin
+	// ContainerImage to repo@sha256:..., falling back to configured mirrors on failure
+	if *pinDigests {
+		digestMapping := resolveDigests(ctx, imagesToPull, mirrorMap, credentials)
+		err := writeDigestMappingFile(*digestMappingPath, digestMapping)
+		if err != nil {
+			log.Info().Msgf("Failed writing digest mapping file %v: %v", *digestMappingPath, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(imagesToPull))
+
+	// login, including for images discovered in Dockerfiles, not just the manifest stages
+	loginIfRequired(ctx, credentials, dockerfileImages, dedupedStages...)
+
+	// pull all images in parallel, using the configured backend, bounded by --max-parallel and retrying
+	// transient failures with backoff
+	maxParallelCount := *maxParallel
+	if maxParallelCount < 1 {
+		// a non-positive value would make the semaphore channel unbuffered and undrained, deadlocking forever
+		maxParallelCount = 1
+	}
+	semaphore := make(chan struct{}, maxParallelCount)
+	var imagesPulled int64
+	for _, image := range imagesToPull {
+		semaphore <- struct{}{}
+		go func(image string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			log.Info().Msgf("Pulling container image %v via %v backend\n", image, *backend)
+			duration, err := pullImageWithRetry(ctx, *backend, image, *contentStorePath, credentials, *maxRetries, *retryBackoffStrategy, mirrorMap)
+			recordPullMetrics(image, duration, err)
+			if err != nil {
+				log.Info().Msgf("Failed pulling container image %v after %v seconds: %v", image, duration.Seconds(), err)
+				return
+			}
+			atomic.AddInt64(&imagesPulled, 1)
+			log.Info().Msgf("Pulled container image %v in %v seconds\n", image, duration.Seconds())
+		}(image)
+	}
+
+	// wait for all pulls to finish
+	wg.Wait()
+
+	return int(imagesPulled)
+}
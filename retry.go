@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"regexp"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	backoffExponential = "exponential"
+	backoffLinear      = "linear"
+)
+
+// transientErrorPatterns match error output known to be caused by transient conditions (rate limiting, timeouts,
+// upstream 5xx) rather than a genuinely broken image reference, and are therefore worth retrying.
+var transientErrorPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)TLS handshake timeout`),
+	regexp.MustCompile(`(?i)toomanyrequests`),
+	regexp.MustCompile(`(?i)i/o timeout`),
+	regexp.MustCompile(`\b(502|503|504)\b`),
+}
+
+// isTransientError reports whether err looks like a transient failure worth retrying.
+func isTransientError(err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	message := err.Error()
+	for _, pattern := range transientErrorPatterns {
+		if pattern.MatchString(message) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryBackoff returns how long to wait before the given retry attempt (1-indexed), following either a linear or
+// exponential strategy, with random jitter so concurrent workers don't retry in lockstep.
+func retryBackoff(strategy string, attempt int) time.Duration {
+
+	var base time.Duration
+	switch strategy {
+	case backoffLinear:
+		base = time.Duration(attempt) * time.Second
+	default:
+		base = time.Duration(math.Pow(2, float64(attempt-1))) * time.Second
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(time.Second)))
+
+	return base + jitter
+}
+
+// pullImageWithRetry wraps pullImage with a bounded retry policy for transient failures, falling back to a
+// configured mirror once the primary pull has failed (after the retries are exhausted, or right away for a
+// non-transient error), and returns how long pulling the image took in total, for per-image timing visibility.
+func pullImageWithRetry(ctx context.Context, backend, image, contentStorePath string, credentials []ContainerRegistryCredentials, maxRetries int, backoffStrategy string, mirrorMap map[string]string) (time.Duration, error) {
+
+	pullStart := time.Now()
+
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			wait := retryBackoff(backoffStrategy, attempt)
+			log.Info().Msgf("Retrying pull of %v in %v (attempt %v/%v) after transient error: %v\n", image, wait, attempt, maxRetries, err)
+			time.Sleep(wait)
+		}
+
+		err = pullImage(ctx, backend, image, contentStorePath, credentials)
+		if err == nil {
+			break
+		}
+
+		if !isTransientError(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		if mirrorImage, ok := rewriteToMirror(image, mirrorMap); ok {
+			log.Info().Msgf("Falling back to mirror %v for %v after primary pull failed: %v\n", mirrorImage, image, err)
+			err = pullImage(ctx, backend, mirrorImage, contentStorePath, credentials)
+		}
+	}
+
+	return time.Since(pullStart), err
+}
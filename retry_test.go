@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"NilError", nil, false},
+		{"TLSHandshakeTimeout", errors.New("net/http: TLS handshake timeout"), true},
+		{"TooManyRequests", errors.New("toomanyrequests: too many requests"), true},
+		{"IOTimeout", errors.New("read tcp: i/o timeout"), true},
+		{"UpstreamBadGateway", errors.New("received unexpected HTTP status: 502 Bad Gateway"), true},
+		{"NotFound", errors.New("manifest unknown: manifest not found"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.transient, isTransientError(test.err))
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Run("LinearGrowsByOneSecondPerAttempt", func(t *testing.T) {
+		backoff := retryBackoff(backoffLinear, 2)
+
+		assert.True(t, backoff >= 2*time.Second && backoff < 3*time.Second)
+	})
+
+	t.Run("ExponentialDoublesPerAttempt", func(t *testing.T) {
+		backoff := retryBackoff(backoffExponential, 3)
+
+		assert.True(t, backoff >= 4*time.Second && backoff < 5*time.Second)
+	})
+}
+
+func TestCapNumCPU(t *testing.T) {
+	t.Run("NeverExceedsMax", func(t *testing.T) {
+		assert.True(t, capNumCPU(1) <= 1)
+	})
+}
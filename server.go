@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	manifest "github.com/estafette/estafette-ci-manifest"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// runServer starts the long-running daemon mode enabled by --serve: a small http api exposing /metrics for
+// Prometheus scraping and a POST /prefetch endpoint accepting a JSON array of stage definitions, so a node-local
+// DaemonSet can keep images warm across multiple builds on the same host. It blocks until ctx is cancelled.
+func runServer(ctx context.Context) {
+
+	var credentials []ContainerRegistryCredentials
+	if *credentialsJSON != "" {
+		err := json.Unmarshal([]byte(*credentialsJSON), &credentials)
+		if err != nil {
+			log.Info().Msgf("Failed unmarshalling injected credentials: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/prefetch", func(w http.ResponseWriter, r *http.Request) {
+		handlePrefetchRequest(w, r, credentials)
+	})
+
+	server := &http.Server{
+		Addr:    *serveAddress,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.Info().Msgf("Serving metrics and prefetch api on %v...", *serveAddress)
+
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal().Err(err).Msg("Failed starting http server")
+	}
+}
+
+// handlePrefetchRequest runs a prefetch cycle for the stages posted in the request body and responds with how many
+// images were pulled.
+func handlePrefetchRequest(w http.ResponseWriter, r *http.Request, credentials []ContainerRegistryCredentials) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var stages []*manifest.EstafetteStage
+	err := json.NewDecoder(r.Body).Decode(&stages)
+	if err != nil {
+		http.Error(w, "failed decoding stages from request body", http.StatusBadRequest)
+		return
+	}
+
+	imagesPulled := runPrefetch(r.Context(), credentials, stages)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"imagesPulled": imagesPulled})
+}
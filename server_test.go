@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlePrefetchRequest(t *testing.T) {
+	t.Run("RejectsNonPostMethod", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/prefetch", nil)
+		w := httptest.NewRecorder()
+
+		handlePrefetchRequest(w, r, nil)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("RejectsMalformedBody", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/prefetch", strings.NewReader("not json"))
+		w := httptest.NewRecorder()
+
+		handlePrefetchRequest(w, r, nil)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("RunsPrefetchForValidEmptyStageArray", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/prefetch", strings.NewReader("[]"))
+		w := httptest.NewRecorder()
+
+		handlePrefetchRequest(w, r, nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"imagesPulled":0}`, w.Body.String())
+	})
+}